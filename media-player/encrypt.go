@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/encrypt"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	sseMode    = flag.String("sse", "none", "Server-side encryption mode for objects: none, s3 or c.")
+	sseKeyFile = flag.String("sse-key-file", "", "Path to a file holding the SSE-C customer key as 64 hex characters (32 bytes), required when -sse=c.")
+)
+
+// sseHolder wraps encrypt.ServerSide so it can be stored in an atomic.Value:
+// the interface value itself may be nil (encryption disabled), which
+// atomic.Value rejects, and atomic.Value also requires every Store to use
+// the same concrete type, which a bare interface can't guarantee across a
+// key rotation.
+type sseHolder struct {
+	sse encrypt.ServerSide
+}
+
+// getSSE returns the ServerSide currently in effect, safe to call from any
+// handler goroutine concurrently with setSSE.
+func (api *mediaHandlers) getSSE() encrypt.ServerSide {
+	v, _ := api.sse.Load().(sseHolder)
+	return v.sse
+}
+
+// setSSE atomically swaps the ServerSide every handler sees, used by
+// RotateKeyHandler so every stream started after the swap uses the new key.
+// A stream already in progress keeps the ServerSide it loaded when it began.
+func (api *mediaHandlers) setSSE(sse encrypt.ServerSide) {
+	api.sse.Store(sseHolder{sse: sse})
+}
+
+// loadServerSide builds the encrypt.ServerSide to attach to requests for
+// SSE-C objects from -sse/-sse-key-file. It returns nil when encryption is
+// disabled or handled entirely server-side (-sse=s3 needs no customer key
+// on the client).
+func loadServerSide() (encrypt.ServerSide, error) {
+	switch *sseMode {
+	case "", "none", "s3":
+		return nil, nil
+	case "c":
+		if *sseKeyFile == "" {
+			return nil, fmt.Errorf("-sse-key-file is required when -sse=c")
+		}
+		key, err := decodeSSECKeyFile(*sseKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return encrypt.NewSSEC(key)
+	default:
+		return nil, fmt.Errorf("unsupported -sse mode %q, must be one of none, s3, c", *sseMode)
+	}
+}
+
+// decodeSSECKeyFile reads a 32-byte SSE-C customer key, hex-encoded, from
+// path. Storing it hex-encoded keeps the file editable as plain text - a
+// trailing newline can be trimmed safely - without the risk of silently
+// truncating raw binary key material the way trimming whitespace off it
+// directly would (a key happening to start or end with a whitespace byte).
+func decodeSSECKeyFile(path string) ([]byte, error) {
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(string(bytes.TrimSpace(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("sse key file must contain a 64-character hex-encoded 32-byte key: %v", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("sse key file must decode to 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// StreamObjectHandler proxies objname through the server instead of
+// presigning it. SSE-C objects need the customer-key headers attached to
+// every request, which a presigned URL alone can't carry, so for those the
+// server attaches them and streams the decrypted bytes back, forwarding
+// Range requests for seeking. SSE-S3 objects keep using presigned URLs
+// unchanged; this endpoint exists only for the SSE-C case.
+func (api *mediaHandlers) StreamObjectHandler(c *gin.Context) {
+	s3, ok := api.store.(*s3Store)
+	if !ok {
+		c.String(http.StatusNotImplemented, "stream is only available on the s3 backend")
+		return
+	}
+
+	objectName := c.Query("objname")
+	if objectName == "" {
+		c.String(http.StatusBadRequest, "No object name set, invalid request.")
+		return
+	}
+
+	opts := minio.GetObjectOptions{ServerSideEncryption: api.getSSE()}
+	rangeStart, rangeEnd := int64(0), int64(-1)
+	isRange := false
+	if rangeHeader := c.GetHeader("Range"); rangeHeader != "" {
+		if start, end, ok := parseRangeHeader(rangeHeader); ok {
+			rangeStart, rangeEnd = start, end
+			isRange = true
+			// minio-go's SetRange has no "-1 means to the end" sentinel, so
+			// an open-ended range (end < 0) has to be built explicitly:
+			// "bytes=0-" is the whole object, so leave opts unranged and
+			// just fetch everything; "bytes=start-" for start > 0 is
+			// SetRange(start, 0), not SetRange(start, -1).
+			var err error
+			switch {
+			case end >= 0:
+				err = opts.SetRange(start, end)
+			case start > 0:
+				err = opts.SetRange(start, 0)
+			}
+			if err != nil {
+				c.String(http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+	}
+
+	obj, err := s3.client.GetObject(s3.bucket, objectName, opts)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer obj.Close()
+
+	info, err := obj.Stat()
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("Content-Type", info.ContentType)
+
+	status := http.StatusOK
+	contentLength := info.Size
+	if isRange {
+		// A missing end (rangeEnd == -1) means "to the end of the
+		// object" - resolve it before computing the served length and
+		// the Content-Range header RFC 7233 requires on a 206.
+		if rangeEnd < 0 || rangeEnd >= info.Size {
+			rangeEnd = info.Size - 1
+		}
+		contentLength = rangeEnd - rangeStart + 1
+		c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rangeStart, rangeEnd, info.Size))
+		status = http.StatusPartialContent
+	}
+	c.Header("Content-Length", strconv.FormatInt(contentLength, 10))
+	c.Status(status)
+	io.Copy(c.Writer, obj)
+}
+
+// parseRangeHeader parses a single-range "bytes=start-end" Range header, as
+// sent by browser <audio>/<video> elements when seeking. A missing end
+// means "to the end of the object".
+func parseRangeHeader(header string) (start, end int64, ok bool) {
+	header = strings.TrimPrefix(header, "bytes=")
+	parts := strings.SplitN(header, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if parts[1] == "" {
+		return start, -1, true
+	}
+	end, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// RotateKeyHandler re-encrypts every object under the optional prefix query
+// parameter with a new SSE-C key read from newKeyFile, copying each object
+// onto itself with the old key as the copy source and the new key as the
+// destination. Only meaningful when the server is running with -sse=c.
+func (api *mediaHandlers) RotateKeyHandler(c *gin.Context) {
+	s3, ok := api.store.(*s3Store)
+	if !ok {
+		c.String(http.StatusNotImplemented, "key rotation is only available on the s3 backend")
+		return
+	}
+	if *sseMode != "c" {
+		c.String(http.StatusBadRequest, "key rotation only applies when -sse=c")
+		return
+	}
+
+	newKeyFile := c.PostForm("newKeyFile")
+	if newKeyFile == "" {
+		c.String(http.StatusBadRequest, "newKeyFile is required")
+		return
+	}
+	newKey, err := decodeSSECKeyFile(newKeyFile)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	newSSE, err := encrypt.NewSSEC(newKey)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	tracks, err := api.store.ListTracks(c.Query("prefix"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	oldSSE := api.getSSE()
+	var rotated int
+	for _, track := range tracks {
+		src := minio.NewSourceInfo(s3.bucket, track.Key, oldSSE)
+		dst, err := minio.NewDestinationInfo(s3.bucket, track.Key, newSSE, nil)
+		if err != nil {
+			log.Println("RotateKeyHandler: failed building destination for", track.Key, err)
+			continue
+		}
+		if err := s3.client.CopyObject(dst, src); err != nil {
+			log.Println("RotateKeyHandler: failed to rotate key for", track.Key, err)
+			continue
+		}
+		rotated++
+	}
+
+	api.setSSE(newSSE)
+	c.JSON(http.StatusOK, gin.H{"rotated": rotated, "total": len(tracks)})
+}
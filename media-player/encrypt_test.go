@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseRangeHeader(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		wantStart int64
+		wantEnd   int64
+		wantOK    bool
+	}{
+		{name: "bounded range", header: "bytes=0-499", wantStart: 0, wantEnd: 499, wantOK: true},
+		{name: "open-ended range", header: "bytes=500-", wantStart: 500, wantEnd: -1, wantOK: true},
+		{name: "missing bytes prefix is tolerated", header: "0-10", wantStart: 0, wantEnd: 10, wantOK: true},
+		{name: "missing dash", header: "bytes=500", wantOK: false},
+		{name: "non numeric start", header: "bytes=a-10", wantOK: false},
+		{name: "non numeric end", header: "bytes=0-a", wantOK: false},
+		{name: "empty", header: "", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, ok := parseRangeHeader(tt.header)
+			if ok != tt.wantOK {
+				t.Fatalf("parseRangeHeader(%q) ok = %v, want %v", tt.header, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Fatalf("parseRangeHeader(%q) = (%d, %d), want (%d, %d)", tt.header, start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func writeKeyFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sse.key")
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDecodeSSECKeyFile(t *testing.T) {
+	want := "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+	t.Run("valid hex key with trailing newline", func(t *testing.T) {
+		key, err := decodeSSECKeyFile(writeKeyFile(t, want+"\n"))
+		if err != nil {
+			t.Fatalf("decodeSSECKeyFile() error = %v", err)
+		}
+		if len(key) != 32 {
+			t.Fatalf("decodeSSECKeyFile() returned %d bytes, want 32", len(key))
+		}
+	})
+
+	t.Run("wrong length", func(t *testing.T) {
+		if _, err := decodeSSECKeyFile(writeKeyFile(t, "deadbeef")); err == nil {
+			t.Fatal("decodeSSECKeyFile() expected an error for a short key, got nil")
+		}
+	})
+
+	t.Run("not hex", func(t *testing.T) {
+		if _, err := decodeSSECKeyFile(writeKeyFile(t, "this is not hex, just 32 raw bytes!")); err == nil {
+			t.Fatal("decodeSSECKeyFile() expected an error for non-hex content, got nil")
+		}
+	})
+}
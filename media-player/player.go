@@ -3,9 +3,12 @@ package main
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +21,7 @@ var (
 	endPoint    = flag.String("e", "https://play.minio.io:9000", "Choose a custom endpoint.")
 	logFilePath = flag.String("l", "./minio-go-media-player.log", "Set a log file.")
 	port  = flag.String("p", "8080", "Port to serve.")
+	backend     = flag.String("backend", "s3", "Object storage backend to serve media from: s3, azure or gcs.")
 )
 
 // The mediaPlayList for the music player on the browser.
@@ -29,8 +33,14 @@ type mediaPlayList struct {
 
 // mediaHandlers media handlers.
 type mediaHandlers struct {
-	minioClient         *minio.Client
+	store               MediaStore
 	currentPlayingMedia string
+	hub                 *playlistHub
+	// sse holds an sseHolder so it can be read/swapped atomically:
+	// StreamObjectHandler and RotateKeyHandler run on different request
+	// goroutines sharing the same *mediaHandlers, and a rotation must be
+	// visible to every stream that starts after it. See getSSE/setSSE.
+	sse atomic.Value
 }
 
 var supportedAccesEnvs = []string{
@@ -89,6 +99,45 @@ func findHost(urlStr string) string {
 	return u.Host
 }
 
+// presignOverrides builds the S3 response-* overrides forwarded as reqParams
+// to MediaStore.PresignGet from the optional download/filename/contentType/
+// cacheMaxAge/expires request parameters accepted by the presign handlers.
+func presignOverrides(download, filename, contentType, cacheMaxAge, expires string) (url.Values, error) {
+	reqParams := url.Values{}
+	if download == "1" {
+		disposition := "attachment"
+		if filename != "" {
+			disposition = fmt.Sprintf("attachment; filename=%q", filename)
+		}
+		reqParams.Set("response-content-disposition", disposition)
+	}
+	if contentType != "" {
+		reqParams.Set("response-content-type", contentType)
+	}
+	if cacheMaxAge != "" {
+		reqParams.Set("response-cache-control", "max-age="+cacheMaxAge)
+	}
+	if expires != "" {
+		// Catch a malformed timestamp here instead of letting S3 reject the
+		// signed URL later with a less useful error.
+		if _, err := time.Parse(time.RFC1123, expires); err != nil {
+			return nil, fmt.Errorf("invalid expires %q, must be an RFC1123 timestamp: %v", expires, err)
+		}
+		reqParams.Set("response-expires", expires)
+	}
+	return reqParams, nil
+}
+
+// parseExpirySecs parses the optional expirySecs query parameter, falling
+// back to def when it is absent or invalid.
+func parseExpirySecs(expirySecs string, def time.Duration) time.Duration {
+	secs, err := strconv.Atoi(expirySecs)
+	if err != nil || secs <= 0 {
+		return def
+	}
+	return time.Duration(secs) * time.Second
+}
+
 func initLogSetting(filePath string) {
 	customFormatter := new(log.JSONFormatter)
 	customFormatter.TimestampFormat = time.RFC3339Nano
@@ -110,21 +159,39 @@ func main() {
 		log.Fatalln("Bucket name cannot be empty.")
 	}
 
-	// Fetch access keys if possible or fail.
-	accessKey, secretKey := mustGetAccessKeys()
-
 	initLogSetting(*logFilePath)
 
-	// Initialize minio client.
-	minioClient, err := minio.New(findHost(*endPoint), accessKey, secretKey, isSecure(*endPoint))
+	// The s3 backend is the only one that needs a minio client; azure and
+	// gcs fetch their own credentials from the environment in newMediaStore.
+	var minioClient *minio.Client
+	if *backend == "" || *backend == "s3" {
+		accessKey, secretKey := mustGetAccessKeys()
+		var err error
+		minioClient, err = minio.New(findHost(*endPoint), accessKey, secretKey, isSecure(*endPoint))
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	store, err := newMediaStore(*backend, *bucketName, minioClient)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	// Initialize media handlers with minio client.
+	sse, err := loadServerSide()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// Initialize media handlers with the selected store.
 	mediaPlayer := mediaHandlers{
-		minioClient: minioClient,
+		store: store,
 	}
+	mediaPlayer.setSSE(sse)
+	// Built once up front, shared by every /list/stream connection, so
+	// concurrent tabs fan out from one backend listener instead of each
+	// racing to start their own.
+	mediaPlayer.hub = newPlaylistHub(&mediaPlayer)
 
 	var enableGin = true
 	if enableGin {
@@ -139,6 +206,23 @@ func main() {
 		// Given point which receives the object name and returns presigned URL in the response.
 		r.GET("/getpresign/v1", mediaPlayer.GetPresignedURLHandler2)
 
+		// Server-Sent Events stream of playlist deltas so open tabs pick
+		// up new uploads without reloading.
+		r.GET("/list/stream", mediaPlayer.StreamPlaylistHandler)
+
+		// S3 Select-backed metadata search for building dynamic playlists.
+		r.GET("/search/v1", mediaPlayer.SearchHandler)
+		r.POST("/catalogue/rebuild", mediaPlayer.RebuildCatalogueHandler)
+
+		// Resumable multipart upload, with progress reported over SSE.
+		r.POST("/upload/v1", mediaPlayer.UploadHandler)
+		r.GET("/upload/v1/progress", mediaPlayer.UploadProgressHandler)
+
+		// Proxies SSE-C encrypted objects through the server, since a
+		// presigned URL alone can't carry the customer-key headers.
+		r.GET("/stream/v1", mediaPlayer.StreamObjectHandler)
+		r.POST("/admin/rotate-key", mediaPlayer.RotateKeyHandler)
+
 		r.GET("/media/playing", mediaPlayer.GetPlayingMedia)
 		r.GET("/media/pause", mediaPlayer.PausePlayingMedia)
 		r.POST("/media/playing", mediaPlayer.SetPlayingMedia)
@@ -164,41 +248,34 @@ func main() {
 }
 
 func (api mediaHandlers) ListObjectsHandler2(c *gin.Context) {
-	// Create a done channel to control 'ListObjects' go routine.
-	doneCh := make(chan struct{})
-
-	// Indicate to our routine to exit cleanly upon return.
-	defer close(doneCh)
+	tracks, err := api.store.ListTracks("")
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
 
 	var playListEntries []mediaPlayList
 
 	// Tracks if first object presigned.
 	var firstObjectPresigned bool
 
-	// Set recursive to list all objects.
-	var isRecursive = true
-
-	// List all objects from a bucket-name with a matching prefix.
-	for objectInfo := range api.minioClient.ListObjects(*bucketName, "", isRecursive, doneCh) {
-		if objectInfo.Err != nil {
-			c.String(http.StatusInternalServerError, objectInfo.Err.Error())
-			return
-		}
-		objectName := objectInfo.Key // object name.
+	for _, track := range tracks {
 		playListEntry := mediaPlayList{
-			Key: objectName,
+			Key: track.Key,
 		}
 		if !firstObjectPresigned {
 			// Generating presigned url for the first object in the list.
 			// presigned URL will be generated on the fly for the
-			// other objects when they are played.
-			expirySecs := 24 * 7 * time.Hour // 7 days.
-			presignedURL, err := api.minioClient.PresignedGetObject(*bucketName, objectName, expirySecs, nil)
+			// other objects when they are played. Defaults to 7 days,
+			// but callers can cap the URL lifetime with expirySecs.
+			expiry := parseExpirySecs(c.Query("expirySecs"), 24*7*time.Hour)
+			presignedURL, err := api.store.PresignGet(track.Key, expiry, nil)
 			if err != nil {
 				c.String(http.StatusInternalServerError, err.Error())
 				return
 			}
-			playListEntry.URL = presignedURL.String()
+			playListEntry.URL = presignedURL
+			firstObjectPresigned = true
 		}
 		playListEntries = append(playListEntries, playListEntry)
 	}
@@ -213,41 +290,35 @@ func (api mediaHandlers) ListObjectsHandler2(c *gin.Context) {
 
 // ListObjectsHandler - handler for ListsObjects from the Object Storage server and bucket configured above.
 func (api mediaHandlers) ListObjectsHandler(w http.ResponseWriter, r *http.Request) {
-	// Create a done channel to control 'ListObjects' go routine.
-	doneCh := make(chan struct{})
-
-	// Indicate to our routine to exit cleanly upon return.
-	defer close(doneCh)
+	tracks, err := api.store.ListTracks("")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	var playListEntries []mediaPlayList
 
 	// Tracks if first object presigned.
 	var firstObjectPresigned bool
 
-	// Set recursive to list all objects.
-	var isRecursive = true
-
-	// List all objects from a bucket-name with a matching prefix.
-	for objectInfo := range api.minioClient.ListObjects(*bucketName, "", isRecursive, doneCh) {
-		if objectInfo.Err != nil {
-			http.Error(w, objectInfo.Err.Error(), http.StatusInternalServerError)
-			return
-		}
-		objectName := objectInfo.Key // object name.
+	for _, track := range tracks {
 		playListEntry := mediaPlayList{
-			Key: objectName,
+			Key: track.Key,
 		}
 		if !firstObjectPresigned {
 			// Generating presigned url for the first object in the list.
 			// presigned URL will be generated on the fly for the
-			// other objects when they are played.
-			expirySecs := 1000 * time.Second // 1000 seconds.
-			presignedURL, err := api.minioClient.PresignedGetObject(*bucketName, objectName, expirySecs, nil)
+			// other objects when they are played. Defaults to 1000
+			// seconds, but callers can cap the URL lifetime with
+			// expirySecs.
+			expiry := parseExpirySecs(r.URL.Query().Get("expirySecs"), 1000*time.Second)
+			presignedURL, err := api.store.PresignGet(track.Key, expiry, nil)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			playListEntry.URL = presignedURL.String()
+			playListEntry.URL = presignedURL
+			firstObjectPresigned = true
 		}
 		playListEntries = append(playListEntries, playListEntry)
 	}
@@ -288,6 +359,12 @@ func (api *mediaHandlers) SetPlayingMedia(c *gin.Context) {
 }
 
 // GetPresignedURLHandler - generates presigned access URL for an object.
+//
+// Accepts optional overrides forwarded to the backend as S3 response-*
+// query overrides: download=1 (with an optional filename) to force a
+// "Save As" download, contentType to correct the MIME type of objects
+// uploaded without one, and cacheMaxAge/expires to control downstream
+// caching.
 func (api mediaHandlers) GetPresignedURLHandler2(c *gin.Context) {
 	// The object for which the presigned URL has to be generated is sent as a query
 	// parameter from the client.
@@ -296,15 +373,23 @@ func (api mediaHandlers) GetPresignedURLHandler2(c *gin.Context) {
 		c.String(http.StatusBadRequest, "No object name set, invalid request.")
 		return
 	}
-	presignedURL, err := api.minioClient.PresignedGetObject(*bucketName, objectName, 24*7*time.Hour, nil)
+	reqParams, err := presignOverrides(c.Query("download"), c.Query("filename"), c.Query("contentType"), c.Query("cacheMaxAge"), c.Query("expires"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	presignedURL, err := api.store.PresignGet(objectName, 24*7*time.Hour, reqParams)
 	if err != nil {
 		c.String(http.StatusInternalServerError, err.Error())
 		return
 	}
-	c.String(http.StatusOK, presignedURL.String())
+	c.String(http.StatusOK, presignedURL)
 }
 
 // GetPresignedURLHandler - generates presigned access URL for an object.
+//
+// Accepts the same download/filename/contentType/cacheMaxAge/expires
+// overrides as GetPresignedURLHandler2.
 func (api mediaHandlers) GetPresignedURLHandler(w http.ResponseWriter, r *http.Request) {
 	// The object for which the presigned URL has to be generated is sent as a query
 	// parameter from the client.
@@ -313,10 +398,16 @@ func (api mediaHandlers) GetPresignedURLHandler(w http.ResponseWriter, r *http.R
 		http.Error(w, "No object name set, invalid request.", http.StatusBadRequest)
 		return
 	}
-	presignedURL, err := api.minioClient.PresignedGetObject(*bucketName, objectName, 24*7*time.Hour, nil)
+	q := r.URL.Query()
+	reqParams, err := presignOverrides(q.Get("download"), q.Get("filename"), q.Get("contentType"), q.Get("cacheMaxAge"), q.Get("expires"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	presignedURL, err := api.store.PresignGet(objectName, 24*7*time.Hour, reqParams)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.Write([]byte(presignedURL.String()))
+	w.Write([]byte(presignedURL))
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPresignOverrides(t *testing.T) {
+	reqParams, err := presignOverrides("1", "track one.mp3", "audio/mpeg", "3600", "Mon, 02 Jan 2006 15:04:05 GMT")
+	if err != nil {
+		t.Fatalf("presignOverrides() error = %v", err)
+	}
+
+	if got, want := reqParams.Get("response-content-disposition"), `attachment; filename="track one.mp3"`; got != want {
+		t.Errorf("response-content-disposition = %q, want %q", got, want)
+	}
+	if got, want := reqParams.Get("response-content-type"), "audio/mpeg"; got != want {
+		t.Errorf("response-content-type = %q, want %q", got, want)
+	}
+	if got, want := reqParams.Get("response-cache-control"), "max-age=3600"; got != want {
+		t.Errorf("response-cache-control = %q, want %q", got, want)
+	}
+	if got, want := reqParams.Get("response-expires"), "Mon, 02 Jan 2006 15:04:05 GMT"; got != want {
+		t.Errorf("response-expires = %q, want %q", got, want)
+	}
+}
+
+func TestPresignOverridesDownloadWithoutFilename(t *testing.T) {
+	reqParams, err := presignOverrides("1", "", "", "", "")
+	if err != nil {
+		t.Fatalf("presignOverrides() error = %v", err)
+	}
+	if got, want := reqParams.Get("response-content-disposition"), "attachment"; got != want {
+		t.Errorf("response-content-disposition = %q, want %q", got, want)
+	}
+}
+
+func TestPresignOverridesEmpty(t *testing.T) {
+	reqParams, err := presignOverrides("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("presignOverrides() error = %v", err)
+	}
+	if len(reqParams) != 0 {
+		t.Errorf("expected no overrides, got %v", reqParams)
+	}
+}
+
+func TestPresignOverridesInvalidExpires(t *testing.T) {
+	if _, err := presignOverrides("", "", "", "", "not-a-timestamp"); err == nil {
+		t.Fatal("presignOverrides() expected an error for a malformed expires value, got nil")
+	}
+}
+
+func TestParseExpirySecs(t *testing.T) {
+	tests := []struct {
+		name       string
+		expirySecs string
+		def        time.Duration
+		want       time.Duration
+	}{
+		{name: "valid", expirySecs: "60", def: time.Hour, want: 60 * time.Second},
+		{name: "empty falls back", expirySecs: "", def: time.Hour, want: time.Hour},
+		{name: "non numeric falls back", expirySecs: "abc", def: time.Hour, want: time.Hour},
+		{name: "zero falls back", expirySecs: "0", def: time.Hour, want: time.Hour},
+		{name: "negative falls back", expirySecs: "-5", def: time.Hour, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseExpirySecs(tt.expirySecs, tt.def); got != tt.want {
+				t.Errorf("parseExpirySecs(%q, %v) = %v, want %v", tt.expirySecs, tt.def, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhowden/tag"
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// catalogueObject is the sidecar CSV object S3 Select queries run against.
+// It holds one row per track: key,title,artist,album,genre,duration,year.
+const catalogueObject = "catalogue.csv"
+
+// buildSelectExpression translates the genre/year/q query filters accepted
+// by SearchHandler into a single S3 Select SQL statement against
+// catalogue.csv. It returns an error if year isn't a plain integer
+// comparison, since that value is interpolated unquoted.
+func buildSelectExpression(c *gin.Context) (string, error) {
+	var clauses []string
+	if genre := c.Query("genre"); genre != "" {
+		clauses = append(clauses, fmt.Sprintf("s.genre = '%s'", escapeSQL(genre)))
+	}
+	if year := c.Query("year"); year != "" {
+		op, value := "=", year
+		for _, candidate := range []string{">=", "<=", ">", "<"} {
+			if strings.HasPrefix(year, candidate) {
+				op, value = candidate, strings.TrimPrefix(year, candidate)
+				break
+			}
+		}
+		// value is interpolated unquoted below, so it must be a plain
+		// integer - escapeSQL's quote-doubling doesn't protect an
+		// unquoted numeric context.
+		if _, err := strconv.Atoi(value); err != nil {
+			return "", fmt.Errorf("invalid year filter %q, must be an integer optionally prefixed with >=, <=, > or <", year)
+		}
+		clauses = append(clauses, fmt.Sprintf("CAST(s.year AS INT) %s %s", op, value))
+	}
+	if q := c.Query("q"); q != "" {
+		like := "%" + escapeSQL(q) + "%"
+		clauses = append(clauses, fmt.Sprintf("(s.title LIKE '%s' OR s.artist LIKE '%s')", like, like))
+	}
+
+	expression := "SELECT s.key, s.title, s.artist FROM S3Object s"
+	if len(clauses) > 0 {
+		expression += " WHERE " + strings.Join(clauses, " AND ")
+	}
+	return expression, nil
+}
+
+// escapeSQL escapes single quotes so query filters can't break out of the
+// S3 Select string literals they're interpolated into.
+func escapeSQL(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
+
+// SearchHandler queries the catalogue.csv sidecar object with S3 Select so
+// the player can show filtered views without scanning every object
+// client-side. Only available on the s3 backend.
+func (api mediaHandlers) SearchHandler(c *gin.Context) {
+	s3, ok := api.store.(*s3Store)
+	if !ok {
+		c.String(http.StatusNotImplemented, "search is only available on the s3 backend")
+		return
+	}
+
+	expression, err := buildSelectExpression(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts := minio.SelectObjectOptions{
+		Expression:     expression,
+		ExpressionType: minio.QueryExpressionTypeSQL,
+		InputSerialization: minio.SelectObjectInputSerialization{
+			CSV: &minio.CSVInputOptions{FileHeaderInfo: minio.CSVFileHeaderInfoUse},
+		},
+		OutputSerialization: minio.SelectObjectOutputSerialization{
+			CSV: &minio.CSVOutputOptions{},
+		},
+	}
+
+	results, err := s3.client.SelectObjectContent(context.Background(), s3.bucket, catalogueObject, opts)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer results.Close()
+
+	var playListEntries []mediaPlayList
+	reader := csv.NewReader(results)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		objectName := record[0]
+		presignedURL, err := api.store.PresignGet(objectName, time.Hour, nil)
+		if err != nil {
+			log.Println("SearchHandler: failed to presign", objectName, err)
+			continue
+		}
+		playListEntries = append(playListEntries, mediaPlayList{Key: objectName, URL: presignedURL})
+	}
+
+	playListEntriesJSON, err := json.Marshal(playListEntries)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, string(playListEntriesJSON))
+}
+
+// RebuildCatalogueHandler walks the bucket, reads ID3/container tags off
+// every object and re-uploads catalogue.csv so SearchHandler's S3 Select
+// queries stay fresh. Only available on the s3 backend.
+func (api mediaHandlers) RebuildCatalogueHandler(c *gin.Context) {
+	s3, ok := api.store.(*s3Store)
+	if !ok {
+		c.String(http.StatusNotImplemented, "catalogue rebuild is only available on the s3 backend")
+		return
+	}
+
+	tracks, err := api.store.ListTracks("")
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"key", "title", "artist", "album", "genre", "duration", "year"})
+	for _, track := range tracks {
+		if track.Key == catalogueObject {
+			continue
+		}
+		if err := writer.Write(catalogueRow(s3, track.Key)); err != nil {
+			log.Println("RebuildCatalogueHandler: failed to write row for", track.Key, err)
+		}
+	}
+	writer.Flush()
+
+	_, err = s3.client.PutObject(s3.bucket, catalogueObject, &buf, int64(buf.Len()), minio.PutObjectOptions{ContentType: "text/csv"})
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.String(http.StatusOK, fmt.Sprintf("catalogue rebuilt with %d tracks", len(tracks)))
+}
+
+// catalogueRow reads the ID3/container tags off objectName and returns its
+// catalogue.csv row, falling back to the bare object key when tags can't be
+// read (e.g. the object isn't a tagged media file).
+func catalogueRow(s3 *s3Store, objectName string) []string {
+	obj, err := s3.client.GetObject(s3.bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return []string{objectName, objectName, "", "", "", "", ""}
+	}
+	defer obj.Close()
+
+	meta, err := tag.ReadFrom(obj)
+	if err != nil {
+		return []string{objectName, objectName, "", "", "", "", ""}
+	}
+	year := ""
+	if meta.Year() != 0 {
+		year = strconv.Itoa(meta.Year())
+	}
+	return []string{objectName, meta.Title(), meta.Artist(), meta.Album(), meta.Genre(), "", year}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ginContextWithQuery(rawQuery string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/search/v1?"+rawQuery, nil)
+	return c
+}
+
+func TestBuildSelectExpressionYearFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+	}{
+		{name: "no year filter", query: "q=foo", wantErr: false},
+		{name: "bare integer", query: "year=2010", wantErr: false},
+		{name: "gte integer", query: "year=%3E%3D2010", wantErr: false},
+		{name: "lte integer", query: "year=%3C%3D1999", wantErr: false},
+		{name: "injection attempt", query: "year=0+OR+CAST(s.year+AS+INT)%3E0", wantErr: true},
+		{name: "non numeric", query: "year=abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildSelectExpression(ginContextWithQuery(tt.query))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildSelectExpression(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/minio/minio-go"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/iterator"
+)
+
+// ObjectInfo is the subset of object metadata mediaHandlers needs, independent
+// of which backend produced it.
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+}
+
+// MediaStore abstracts the object-storage backend behind mediaHandlers so the
+// same gin routes can serve tracks from S3/MinIO, Azure Blob Storage or
+// Google Cloud Storage without the handlers knowing which one is in use.
+type MediaStore interface {
+	// ListTracks lists every object under prefix.
+	ListTracks(prefix string) ([]ObjectInfo, error)
+	// PresignGet returns a time-limited URL to read objectName. reqParams
+	// carries optional response overrides (content-disposition, etc); a
+	// backend that cannot honor them ignores what it doesn't support.
+	PresignGet(objectName string, expiry time.Duration, reqParams url.Values) (string, error)
+	// PresignPut returns a time-limited URL to upload objectName.
+	PresignPut(objectName string, expiry time.Duration) (string, error)
+	// Stat returns metadata for a single object.
+	Stat(objectName string) (ObjectInfo, error)
+	// Watch streams added/removed/modified events for objects under prefix
+	// into events until ctx is canceled or the backend stops listening.
+	// Backends that cannot stream notifications return errNotImplemented
+	// so callers fall back to polling ListTracks instead.
+	Watch(ctx context.Context, prefix string, events chan<- StoreEvent) error
+}
+
+// newMediaStore builds the MediaStore selected by -backend. S3/MinIO is the
+// default and reuses minioClient; azure and gcs read their credentials from
+// the environment.
+func newMediaStore(backend string, bucket string, minioClient *minio.Client) (MediaStore, error) {
+	switch backend {
+	case "", "s3":
+		return &s3Store{client: minioClient, bucket: bucket}, nil
+	case "azure":
+		return newAzureStore(bucket)
+	case "gcs":
+		return newGCSStore(bucket)
+	default:
+		return nil, fmt.Errorf("unsupported -backend %q, must be one of s3, azure, gcs", backend)
+	}
+}
+
+// s3Store is the MediaStore backed by the existing minio-go client, serving
+// both real MinIO servers and any S3-compatible endpoint.
+type s3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+func (s *s3Store) ListTracks(prefix string) ([]ObjectInfo, error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	var tracks []ObjectInfo
+	for objectInfo := range s.client.ListObjects(s.bucket, prefix, true, doneCh) {
+		if objectInfo.Err != nil {
+			return nil, objectInfo.Err
+		}
+		tracks = append(tracks, ObjectInfo{
+			Key:         objectInfo.Key,
+			Size:        objectInfo.Size,
+			ContentType: objectInfo.ContentType,
+		})
+	}
+	return tracks, nil
+}
+
+func (s *s3Store) PresignGet(objectName string, expiry time.Duration, reqParams url.Values) (string, error) {
+	presignedURL, err := s.client.PresignedGetObject(s.bucket, objectName, expiry, reqParams)
+	if err != nil {
+		return "", err
+	}
+	return presignedURL.String(), nil
+}
+
+func (s *s3Store) PresignPut(objectName string, expiry time.Duration) (string, error) {
+	presignedURL, err := s.client.PresignedPutObject(s.bucket, objectName, expiry)
+	if err != nil {
+		return "", err
+	}
+	return presignedURL.String(), nil
+}
+
+func (s *s3Store) Stat(objectName string) (ObjectInfo, error) {
+	info, err := s.client.StatObject(s.bucket, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: objectName, Size: info.Size, ContentType: info.ContentType}, nil
+}
+
+// Watch uses the minio-go bucket notification API, which only real MinIO
+// servers support; other S3-compatible endpoints answer with a NotImplemented
+// error that we translate to errNotImplemented for the caller to fall back on.
+func (s *s3Store) Watch(ctx context.Context, prefix string, events chan<- StoreEvent) error {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	eventTypes := []string{"s3:ObjectCreated:*", "s3:ObjectRemoved:*"}
+	notifyCh := s.client.ListenBucketNotification(s.bucket, prefix, "", eventTypes, doneCh)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification, ok := <-notifyCh:
+			if !ok {
+				return nil
+			}
+			if notification.Err != nil {
+				if strings.Contains(notification.Err.Error(), "NotImplemented") {
+					return errNotImplemented
+				}
+				return notification.Err
+			}
+			for _, record := range notification.Records {
+				evType := "modified"
+				switch {
+				case strings.HasPrefix(record.EventName, "s3:ObjectCreated:"):
+					evType = "added"
+				case strings.HasPrefix(record.EventName, "s3:ObjectRemoved:"):
+					evType = "removed"
+				}
+				events <- StoreEvent{Type: evType, Key: record.S3.Object.Key}
+			}
+		}
+	}
+}
+
+// azureStore is the MediaStore backed by Azure Blob Storage, mapping the
+// configured bucket name onto a container. Credentials come from
+// AZURE_STORAGE_ACCOUNT/AZURE_STORAGE_KEY.
+type azureStore struct {
+	container    string
+	containerURL azblob.ContainerURL
+	credential   *azblob.SharedKeyCredential
+}
+
+func newAzureStore(container string) (*azureStore, error) {
+	account := os.Getenv("AZURE_STORAGE_ACCOUNT")
+	key := os.Getenv("AZURE_STORAGE_KEY")
+	if account == "" || key == "" {
+		return nil, fmt.Errorf("AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_KEY must be set for -backend=azure")
+	}
+	credential, err := azblob.NewSharedKeyCredential(account, key)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{})
+	containerURL, err := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/%s", account, container))
+	if err != nil {
+		return nil, err
+	}
+	return &azureStore{
+		container:    container,
+		containerURL: azblob.NewContainerURL(*containerURL, pipeline),
+		credential:   credential,
+	}, nil
+}
+
+func (a *azureStore) ListTracks(prefix string) ([]ObjectInfo, error) {
+	ctx := context.Background()
+	var tracks []ObjectInfo
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		resp, err := a.containerURL.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{Prefix: prefix})
+		if err != nil {
+			return nil, err
+		}
+		for _, blob := range resp.Segment.BlobItems {
+			var size int64
+			if blob.Properties.ContentLength != nil {
+				size = *blob.Properties.ContentLength
+			}
+			var contentType string
+			if blob.Properties.ContentType != nil {
+				contentType = *blob.Properties.ContentType
+			}
+			tracks = append(tracks, ObjectInfo{
+				Key:         blob.Name,
+				Size:        size,
+				ContentType: contentType,
+			})
+		}
+		marker = resp.NextMarker
+	}
+	return tracks, nil
+}
+
+// sasURL builds a SAS URL for objectName valid for expiry, authorizing only
+// the given permissions, in place of the presigned URLs the S3 backend uses.
+func (a *azureStore) sasURL(objectName string, expiry time.Duration, perms azblob.BlobSASPermissions) (string, error) {
+	sasQueryParams, err := azblob.BlobSASSignatureValues{
+		Protocol:      azblob.SASProtocolHTTPS,
+		StartTime:     time.Now().UTC(),
+		ExpiryTime:    time.Now().UTC().Add(expiry),
+		ContainerName: a.container,
+		BlobName:      objectName,
+		Permissions:   perms.String(),
+	}.NewSASQueryParameters(a.credential)
+	if err != nil {
+		return "", err
+	}
+	blobURL := a.containerURL.NewBlobURL(objectName).URL()
+	blobURL.RawQuery = sasQueryParams.Encode()
+	return blobURL.String(), nil
+}
+
+func (a *azureStore) PresignGet(objectName string, expiry time.Duration, reqParams url.Values) (string, error) {
+	// Azure SAS tokens have no equivalent to S3 response-* overrides, so
+	// reqParams is intentionally unused here.
+	return a.sasURL(objectName, expiry, azblob.BlobSASPermissions{Read: true})
+}
+
+func (a *azureStore) PresignPut(objectName string, expiry time.Duration) (string, error) {
+	return a.sasURL(objectName, expiry, azblob.BlobSASPermissions{Create: true, Write: true})
+}
+
+func (a *azureStore) Stat(objectName string) (ObjectInfo, error) {
+	resp, err := a.containerURL.NewBlobURL(objectName).GetProperties(context.Background(), azblob.BlobAccessConditions{})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: objectName, Size: resp.ContentLength(), ContentType: resp.ContentType()}, nil
+}
+
+// Watch is not implemented for Azure Blob Storage; callers fall back to
+// polling ListTracks instead.
+func (a *azureStore) Watch(ctx context.Context, prefix string, events chan<- StoreEvent) error {
+	return errNotImplemented
+}
+
+// gcsStore is the MediaStore backed by Google Cloud Storage, mapping the
+// configured bucket name onto a GCS bucket. Credentials come from
+// GOOGLE_APPLICATION_CREDENTIALS, the same service-account JSON key used to
+// sign the URLs below.
+type gcsStore struct {
+	client *storage.Client
+	bucket string
+	opts   *storage.SignedURLOptions
+}
+
+func newGCSStore(bucket string) (*gcsStore, error) {
+	keyFile := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if keyFile == "" {
+		return nil, fmt.Errorf("GOOGLE_APPLICATION_CREDENTIALS must be set for -backend=gcs")
+	}
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jsonKey, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := google.JWTConfigFromJSON(jsonKey)
+	if err != nil {
+		return nil, err
+	}
+	return &gcsStore{
+		client: client,
+		bucket: bucket,
+		opts: &storage.SignedURLOptions{
+			GoogleAccessID: conf.Email,
+			PrivateKey:     conf.PrivateKey,
+		},
+	}, nil
+}
+
+func (g *gcsStore) ListTracks(prefix string) ([]ObjectInfo, error) {
+	ctx := context.Background()
+	it := g.client.Bucket(g.bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+	var tracks []ObjectInfo
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, ObjectInfo{Key: attrs.Name, Size: attrs.Size, ContentType: attrs.ContentType})
+	}
+	return tracks, nil
+}
+
+func (g *gcsStore) signedURL(objectName string, method string, expiry time.Duration, reqParams url.Values) (string, error) {
+	opts := *g.opts
+	opts.Method = method
+	opts.Expires = time.Now().Add(expiry)
+	if method == http.MethodGet {
+		if ct := reqParams.Get("response-content-type"); ct != "" {
+			opts.ContentType = ct
+		}
+	}
+	return storage.SignedURL(g.bucket, objectName, &opts)
+}
+
+func (g *gcsStore) PresignGet(objectName string, expiry time.Duration, reqParams url.Values) (string, error) {
+	return g.signedURL(objectName, http.MethodGet, expiry, reqParams)
+}
+
+func (g *gcsStore) PresignPut(objectName string, expiry time.Duration) (string, error) {
+	return g.signedURL(objectName, http.MethodPut, expiry, nil)
+}
+
+func (g *gcsStore) Stat(objectName string) (ObjectInfo, error) {
+	attrs, err := g.client.Bucket(g.bucket).Object(objectName).Attrs(context.Background())
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: objectName, Size: attrs.Size, ContentType: attrs.ContentType}, nil
+}
+
+// Watch is not implemented for Google Cloud Storage; callers fall back to
+// polling ListTracks instead.
+func (g *gcsStore) Watch(ctx context.Context, prefix string, events chan<- StoreEvent) error {
+	return errNotImplemented
+}
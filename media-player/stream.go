@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// errNotImplemented is returned by MediaStore.Watch when the backend has no
+// way to stream notifications, so callers should fall back to polling.
+var errNotImplemented = errors.New("watch: not implemented by this backend")
+
+// StoreEvent is a single playlist delta pushed to /list/stream subscribers.
+type StoreEvent struct {
+	Type string // "added", "removed" or "modified".
+	Key  string
+}
+
+// playlistHub fans out a single backend listener (or poller) to every
+// connected browser tab, so N open tabs cost one ListenBucketNotification
+// stream instead of N.
+type playlistHub struct {
+	api *mediaHandlers
+
+	mu          sync.Mutex
+	subscribers map[chan StoreEvent]struct{}
+	started     bool
+}
+
+func newPlaylistHub(api *mediaHandlers) *playlistHub {
+	return &playlistHub{api: api, subscribers: make(map[chan StoreEvent]struct{})}
+}
+
+func (h *playlistHub) subscribe() chan StoreEvent {
+	ch := make(chan StoreEvent, 16)
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	starting := !h.started
+	h.started = true
+	h.mu.Unlock()
+	if starting {
+		go h.run()
+	}
+	return ch
+}
+
+// hasSubscribers reports whether the hub still has at least one connected
+// /list/stream tab, used by run to decide whether to keep reconnecting.
+func (h *playlistHub) hasSubscribers() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers) > 0
+}
+
+func (h *playlistHub) unsubscribe(ch chan StoreEvent) {
+	h.mu.Lock()
+	delete(h.subscribers, ch)
+	h.mu.Unlock()
+	close(ch)
+}
+
+func (h *playlistHub) broadcast(ev StoreEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			// Slow subscriber, drop the event rather than block the hub.
+		}
+	}
+}
+
+// watchRetryDelay bounds how fast run reconnects after Watch's notification
+// channel closes on its own (e.g. a transient server-side drop), so a
+// backend that keeps closing it immediately doesn't spin a tight loop.
+const watchRetryDelay = 2 * time.Second
+
+// run starts the single backend listener for the whole process and keeps it
+// going for as long as the hub has subscribers, reconnecting Watch whenever
+// its channel closes on its own. It falls back to polling ListTracks once
+// the backend reports it can't stream notifications at all.
+func (h *playlistHub) run() {
+	for h.hasSubscribers() {
+		events := make(chan StoreEvent, 16)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for ev := range events {
+				h.broadcast(ev)
+			}
+		}()
+
+		err := h.api.store.Watch(context.Background(), "", events)
+		close(events)
+		<-done
+
+		if err != nil {
+			if !errors.Is(err, errNotImplemented) {
+				log.Println("playlistHub: Watch failed, falling back to polling:", err)
+			}
+			h.poll()
+			return
+		}
+
+		// Watch returning nil just means its notification channel closed
+		// (e.g. a transient reconnect), not "stop forever" - loop and
+		// restart it for as long as the hub still has subscribers.
+		log.Println("playlistHub: Watch channel closed, reconnecting")
+		time.Sleep(watchRetryDelay)
+	}
+
+	h.mu.Lock()
+	h.started = false
+	h.mu.Unlock()
+}
+
+// diffTracks compares the previous poll's known keys against a fresh
+// ListTracks snapshot and returns the added/removed events between them,
+// along with the new known set for the next round.
+func diffTracks(known map[string]struct{}, tracks []ObjectInfo) ([]StoreEvent, map[string]struct{}) {
+	seen := make(map[string]struct{}, len(tracks))
+	var events []StoreEvent
+	for _, track := range tracks {
+		seen[track.Key] = struct{}{}
+		if _, ok := known[track.Key]; !ok {
+			events = append(events, StoreEvent{Type: "added", Key: track.Key})
+		}
+	}
+	for key := range known {
+		if _, ok := seen[key]; !ok {
+			events = append(events, StoreEvent{Type: "removed", Key: key})
+		}
+	}
+	return events, seen
+}
+
+// poll diffs successive ListTracks snapshots every few seconds and
+// synthesizes added/removed events from the difference, used whenever the
+// backend returns NotImplemented for bucket notifications (e.g. non-MinIO S3).
+func (h *playlistHub) poll() {
+	const pollInterval = 5 * time.Second
+
+	known := make(map[string]struct{})
+	for {
+		tracks, err := h.api.store.ListTracks("")
+		if err != nil {
+			log.Println("playlistHub: poll failed:", err)
+			time.Sleep(pollInterval)
+			continue
+		}
+		var events []StoreEvent
+		events, known = diffTracks(known, tracks)
+		for _, ev := range events {
+			h.broadcast(ev)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// StreamPlaylistHandler upgrades to Server-Sent Events: it sends the current
+// playlist snapshot, then forwards added/removed/modified deltas as they
+// happen so the browser never has to reload the page to pick up new uploads.
+func (api *mediaHandlers) StreamPlaylistHandler(c *gin.Context) {
+	tracks, err := api.store.ListTracks("")
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var snapshot []mediaPlayList
+	for i, track := range tracks {
+		entry := mediaPlayList{Key: track.Key}
+		if i == 0 {
+			// Same shape as ListObjectsHandler2: presign only the first
+			// entry up front, the rest get presigned on the fly when played.
+			if presignedURL, err := api.store.PresignGet(track.Key, 24*7*time.Hour, nil); err == nil {
+				entry.URL = presignedURL
+			}
+		}
+		snapshot = append(snapshot, entry)
+	}
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+
+	writeSSE(c.Writer, "snapshot", snapshot)
+	c.Writer.Flush()
+
+	ch := api.hub.subscribe()
+	defer api.hub.unsubscribe(ch)
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			frame := struct {
+				Type string `json:"type"`
+				Key  string `json:"key"`
+				URL  string `json:"url,omitempty"`
+			}{Type: ev.Type, Key: ev.Key}
+			if ev.Type == "added" {
+				if presignedURL, err := api.store.PresignGet(ev.Key, 24*7*time.Hour, nil); err == nil {
+					frame.URL = presignedURL
+				}
+			}
+			writeSSE(c.Writer, "update", frame)
+			c.Writer.Flush()
+		}
+	}
+}
+
+// writeSSE writes a single Server-Sent Events frame with the given event
+// name and a JSON-encoded payload.
+func writeSSE(w http.ResponseWriter, event string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\n", event)
+	for _, line := range strings.Split(string(data), "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func sortedEvents(events []StoreEvent) []StoreEvent {
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Type != events[j].Type {
+			return events[i].Type < events[j].Type
+		}
+		return events[i].Key < events[j].Key
+	})
+	return events
+}
+
+func TestDiffTracks(t *testing.T) {
+	tests := []struct {
+		name       string
+		known      map[string]struct{}
+		tracks     []ObjectInfo
+		wantEvents []StoreEvent
+		wantKnown  map[string]struct{}
+	}{
+		{
+			name:       "empty known set reports every track as added",
+			known:      map[string]struct{}{},
+			tracks:     []ObjectInfo{{Key: "a.mp3"}, {Key: "b.mp3"}},
+			wantEvents: []StoreEvent{{Type: "added", Key: "a.mp3"}, {Type: "added", Key: "b.mp3"}},
+			wantKnown:  map[string]struct{}{"a.mp3": {}, "b.mp3": {}},
+		},
+		{
+			name:       "new track added",
+			known:      map[string]struct{}{"a.mp3": {}},
+			tracks:     []ObjectInfo{{Key: "a.mp3"}, {Key: "b.mp3"}},
+			wantEvents: []StoreEvent{{Type: "added", Key: "b.mp3"}},
+			wantKnown:  map[string]struct{}{"a.mp3": {}, "b.mp3": {}},
+		},
+		{
+			name:       "track removed",
+			known:      map[string]struct{}{"a.mp3": {}, "b.mp3": {}},
+			tracks:     []ObjectInfo{{Key: "a.mp3"}},
+			wantEvents: []StoreEvent{{Type: "removed", Key: "b.mp3"}},
+			wantKnown:  map[string]struct{}{"a.mp3": {}},
+		},
+		{
+			name:       "unchanged snapshot reports nothing",
+			known:      map[string]struct{}{"a.mp3": {}},
+			tracks:     []ObjectInfo{{Key: "a.mp3"}},
+			wantEvents: nil,
+			wantKnown:  map[string]struct{}{"a.mp3": {}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotEvents, gotKnown := diffTracks(tt.known, tt.tracks)
+			if !reflect.DeepEqual(sortedEvents(gotEvents), sortedEvents(tt.wantEvents)) {
+				t.Errorf("diffTracks() events = %v, want %v", gotEvents, tt.wantEvents)
+			}
+			if !reflect.DeepEqual(gotKnown, tt.wantKnown) {
+				t.Errorf("diffTracks() known = %v, want %v", gotKnown, tt.wantKnown)
+			}
+		})
+	}
+}
+
+func TestDiffTracksAddedAndRemovedTogether(t *testing.T) {
+	known := map[string]struct{}{"a.mp3": {}, "b.mp3": {}}
+	tracks := []ObjectInfo{{Key: "b.mp3"}, {Key: "c.mp3"}}
+
+	events, newKnown := diffTracks(known, tracks)
+
+	want := []StoreEvent{{Type: "added", Key: "c.mp3"}, {Type: "removed", Key: "a.mp3"}}
+	if !reflect.DeepEqual(sortedEvents(events), sortedEvents(want)) {
+		t.Errorf("diffTracks() events = %v, want %v", events, want)
+	}
+	wantKnown := map[string]struct{}{"b.mp3": {}, "c.mp3": {}}
+	if !reflect.DeepEqual(newKnown, wantKnown) {
+		t.Errorf("diffTracks() known = %v, want %v", newKnown, wantKnown)
+	}
+}
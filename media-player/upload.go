@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go"
+)
+
+// defaultPartSize is the chunk size UploadHandler streams to the backend in
+// when the request doesn't override it with partSize.
+const defaultPartSize = 16 * 1024 * 1024 // 16 MiB.
+
+// uploadParallelism bounds how many parts PutObjectPart sends concurrently.
+const uploadParallelism = 4
+
+// partJob is one chunk read off the request body, queued for a worker to
+// upload.
+type partJob struct {
+	partNumber int
+	data       []byte
+}
+
+// partResult is a completed (or failed) PutObjectPart call.
+type partResult struct {
+	part minio.CompletePart
+	err  error
+}
+
+// uploadProgress tracks how far a single /upload/v1 request has gotten, so
+// the companion SSE endpoint can report it without touching the upload
+// goroutine directly.
+type uploadProgress struct {
+	mu             sync.Mutex
+	objectName     string
+	s3UploadID     string
+	totalBytes     int64
+	sentBytes      int64
+	partsCompleted int
+	done           bool
+	err            error
+}
+
+func (p *uploadProgress) addSent(n int64) {
+	p.mu.Lock()
+	p.sentBytes += n
+	p.mu.Unlock()
+}
+
+func (p *uploadProgress) completePart() {
+	p.mu.Lock()
+	p.partsCompleted++
+	p.mu.Unlock()
+}
+
+func (p *uploadProgress) finish(err error) {
+	p.mu.Lock()
+	p.done = true
+	p.err = err
+	p.mu.Unlock()
+}
+
+func (p *uploadProgress) snapshot() (sentBytes, totalBytes int64, partsCompleted int, done bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sentBytes, p.totalBytes, p.partsCompleted, p.done, p.err
+}
+
+// uploadRegistry is the in-memory table of in-flight uploads, keyed by the
+// uploadId the progress endpoint polls.
+type uploadRegistry struct {
+	mu      sync.Mutex
+	entries map[string]*uploadProgress
+}
+
+var uploads = uploadRegistry{entries: make(map[string]*uploadProgress)}
+
+func (r *uploadRegistry) register(uploadID string, p *uploadProgress) {
+	r.mu.Lock()
+	r.entries[uploadID] = p
+	r.mu.Unlock()
+}
+
+func (r *uploadRegistry) get(uploadID string) (*uploadProgress, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.entries[uploadID]
+	return p, ok
+}
+
+// progressReader wraps an io.Reader and records every byte read against p,
+// so the SSE progress endpoint can report bytes-sent without the upload
+// handler having to push updates itself.
+type progressReader struct {
+	r io.Reader
+	p *uploadProgress
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	if n > 0 {
+		pr.p.addSent(int64(n))
+	}
+	return n, err
+}
+
+// newUploadID generates a short random id for upload progress tracking; it
+// is distinct from the S3 multipart uploadID so resuming works even when
+// the caller only remembers this one.
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// UploadHandler accepts large audio/video files on /upload/v1 and streams
+// them to the backend bucket as a multipart upload, part-size at a time.
+// Pass uploadId (this server's id, not S3's) to resume an interrupted
+// upload; the client is expected to re-send the body starting at the byte
+// offset reported by the progress endpoint.
+func (api mediaHandlers) UploadHandler(c *gin.Context) {
+	s3, ok := api.store.(*s3Store)
+	if !ok {
+		c.String(http.StatusNotImplemented, "upload is only available on the s3 backend")
+		return
+	}
+
+	objectName := c.Query("objname")
+	if objectName == "" {
+		c.String(http.StatusBadRequest, "No object name set, invalid request.")
+		return
+	}
+
+	partSize := int64(defaultPartSize)
+	if v := c.Query("partSize"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			c.String(http.StatusBadRequest, "partSize must be a positive number of bytes")
+			return
+		}
+		partSize = n
+	}
+
+	core := minio.Core{Client: s3.client}
+
+	uploadID := c.Query("uploadId")
+	s3UploadID := c.Query("s3UploadId")
+	partNumber := 1
+	var progress *uploadProgress
+	var completeParts []minio.CompletePart
+
+	if uploadID != "" {
+		existing, ok := uploads.get(uploadID)
+		if !ok {
+			c.String(http.StatusNotFound, "unknown uploadId")
+			return
+		}
+		progress = existing
+		if s3UploadID == "" {
+			s3UploadID = existing.s3UploadID
+		}
+		result, err := core.ListObjectParts(s3.bucket, objectName, s3UploadID, 0, 10000)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		// Seed the already-uploaded parts so CompleteMultipartUpload
+		// includes them too, not just the parts this attempt sends.
+		for _, part := range result.ObjectParts {
+			completeParts = append(completeParts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+		}
+		partNumber = len(result.ObjectParts) + 1
+	} else {
+		var err error
+		uploadID, err = newUploadID()
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		s3UploadID, err = core.NewMultipartUpload(s3.bucket, objectName, minio.PutObjectOptions{})
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		progress = &uploadProgress{objectName: objectName, s3UploadID: s3UploadID, totalBytes: c.Request.ContentLength}
+		uploads.register(uploadID, progress)
+	}
+
+	reader := &progressReader{r: c.Request.Body, p: progress}
+
+	// Parts are read off the body sequentially - it's a single HTTP
+	// stream, so reads can't be parallelized - but a pool of workers
+	// sends the resulting parts to the backend concurrently, so
+	// PutObjectPart's network latency overlaps across parts.
+	jobs := make(chan partJob, uploadParallelism)
+	results := make(chan partResult, uploadParallelism)
+
+	var wg sync.WaitGroup
+	for i := 0; i < uploadParallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				objPart, err := core.PutObjectPart(s3.bucket, objectName, s3UploadID, job.partNumber, bytes.NewReader(job.data), int64(len(job.data)), "", "", nil)
+				if err != nil {
+					results <- partResult{err: err}
+					continue
+				}
+				progress.completePart()
+				results <- partResult{part: minio.CompletePart{PartNumber: objPart.PartNumber, ETag: objPart.ETag}}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	readErrCh := make(chan error, 1)
+	go func() {
+		defer close(jobs)
+		buf := make([]byte, partSize)
+		for {
+			n, err := io.ReadFull(reader, buf)
+			if n > 0 {
+				data := make([]byte, n)
+				copy(data, buf[:n])
+				jobs <- partJob{partNumber: partNumber, data: data}
+				partNumber++
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				readErrCh <- nil
+				return
+			}
+			if err != nil {
+				readErrCh <- err
+				return
+			}
+		}
+	}()
+
+	var uploadErr error
+	for res := range results {
+		if res.err != nil {
+			if uploadErr == nil {
+				uploadErr = res.err
+			}
+			continue
+		}
+		completeParts = append(completeParts, res.part)
+	}
+	if err := <-readErrCh; err != nil && uploadErr == nil {
+		uploadErr = err
+	}
+	if uploadErr != nil {
+		progress.finish(uploadErr)
+		c.String(http.StatusInternalServerError, uploadErr.Error())
+		return
+	}
+
+	// Parts can complete out of order since they're uploaded
+	// concurrently; CompleteMultipartUpload requires ascending order.
+	sort.Slice(completeParts, func(i, j int) bool {
+		return completeParts[i].PartNumber < completeParts[j].PartNumber
+	})
+
+	if _, err := core.CompleteMultipartUpload(s3.bucket, objectName, s3UploadID, completeParts); err != nil {
+		progress.finish(err)
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	progress.finish(nil)
+
+	c.JSON(http.StatusOK, gin.H{"uploadId": uploadID, "s3UploadId": s3UploadID, "key": objectName})
+}
+
+// UploadProgressHandler streams bytes-sent/total and completed part counts
+// for uploadId over Server-Sent Events until the upload finishes or the
+// client disconnects.
+func (api mediaHandlers) UploadProgressHandler(c *gin.Context) {
+	uploadID := c.Query("uploadId")
+	progress, ok := uploads.get(uploadID)
+	if !ok {
+		c.String(http.StatusNotFound, "unknown uploadId")
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ticker.C:
+			sentBytes, totalBytes, partsCompleted, done, err := progress.snapshot()
+			frame := gin.H{
+				"sentBytes":      sentBytes,
+				"totalBytes":     totalBytes,
+				"partsCompleted": partsCompleted,
+				"done":           done,
+			}
+			if err != nil {
+				frame["error"] = err.Error()
+			}
+			writeSSE(c.Writer, "progress", frame)
+			c.Writer.Flush()
+			if done {
+				return
+			}
+		}
+	}
+}